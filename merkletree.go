@@ -1,10 +1,7 @@
 package merkletree
 
 import (
-	"encoding/hex"
-	"crypto/sha1"
-	"fmt"
-	//	"log"
+	"hash"
 )
 
 const (
@@ -13,26 +10,51 @@ const (
 	C = "C"
 )
 
-type Hash [sha1.Size]byte
+// RFC 6962 domain separation prefixes, so that a leaf hash can never
+// be mistaken for an internal node hash (and vice versa).
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
 type Position string // L or R
 
 // a particular tree, can be either a node (containing a hash and
 // children nodes) or it could be just a leaf.
 type MerkleTree struct {
-	hash        Hash
-	left        *MerkleTree
-	right       *MerkleTree
-	data        []byte
-	depth       int
-	pos         Position
+	hash    []byte
+	left    *MerkleTree
+	right   *MerkleTree
+	parent  *MerkleTree
+	data    []byte
+	depth   int
+	pos     Position
+	newHash func() hash.Hash
+
+	// leaves and leafIndex are only populated on the root node
+	// returned by NewMerkleTree: leaves holds every leaf in order,
+	// and leafIndex maps a leaf's hash (as a string) to its index
+	// into leaves, so Proof can look a chunk up in O(1) instead of
+	// scanning the tree for it.
+	leaves    []*MerkleTree
+	leafIndex map[string]int
 }
 
-func (h Hash) String() string {
-	return hex.EncodeToString(h[:])
+// leafHash computes H(0x00 || data), per RFC 6962.
+func leafHash(newHash func() hash.Hash, data []byte) []byte {
+	h := newHash()
+	h.Write([]byte{leafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
 }
 
-func hash(data []byte) Hash {
-	return sha1.Sum(data)
+// nodeHash computes H(0x01 || left || right), per RFC 6962.
+func nodeHash(newHash func() hash.Hash, left, right []byte) []byte {
+	h := newHash()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
 }
 
 // operations
@@ -40,120 +62,120 @@ func hash(data []byte) Hash {
 // 2. construct a proof for a particular leaf node
 // 3. verify the proof
 
-// takes a slice of byte slices and returns a MerkleTree
-// for now, assume, len(chunks) is a power of 2
-func NewMerkleTree(chunks [][]byte) *MerkleTree {
-	// build the tree bottom up
-	if len(chunks) < 2 {
+// largestPow2LessThan returns the largest power of two strictly less
+// than n, for n >= 2. This is the split point RFC 6962's MTH uses:
+// left gets the first k leaves, right gets the remaining n-k, and
+// each side recurses the same way. An odd leaf left over at any level
+// falls out as the base case of the recursion (n == 1) and is
+// promoted to the next level unchanged, rather than being duplicated
+// the way naive (e.g. early Bitcoin) implementations do -- so no
+// extra Position sentinel is needed to mark a "promoted" node, the
+// recursion just never builds one.
+func largestPow2LessThan(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+// takes a hash factory and a slice of byte slices and returns a
+// MerkleTree. Trees need not have a power-of-2 number of leaves.
+func NewMerkleTree(newHash func() hash.Hash, chunks [][]byte) *MerkleTree {
+	if len(chunks) == 0 {
 		return nil
 	}
 
-	leafs := []MerkleTree{}
-	// create leafs
-	for i := 0; i < len(chunks) - 1; i = i+2 {
-		c0 := chunks[i]
-		c1 := chunks[i+1]
+	leafs := make([]*MerkleTree, len(chunks))
+	for i, c := range chunks {
+		leafs[i] = &MerkleTree{
+			hash:    leafHash(newHash, c),
+			data:    c,
+			newHash: newHash,
+		}
+	}
 
-		h0 := hash(c0)
-		h1 := hash(c1)
+	root := buildSubtree(newHash, leafs)
+	root.pos = C
 
-		l0 := MerkleTree{
-			hash: h0,
-			data: c0,
-			pos: L,
+	root.leaves = leafs
+	root.leafIndex = make(map[string]int, len(leafs))
+	for i, l := range leafs {
+		// First occurrence wins, so a chunk that repeats resolves
+		// to its leftmost leaf.
+		if _, exists := root.leafIndex[string(l.hash)]; !exists {
+			root.leafIndex[string(l.hash)] = i
 		}
-		l1 := MerkleTree{
-			hash: h1,
-			data: c1,
-			pos: R,
-		}
-
-		leafs = append(leafs, l0)
-		leafs = append(leafs, l1)
 	}
 
-	// create other nodes, recursively, until we only have one node left in the list.
-	togglePos := 0
-	for {
-		if len(leafs) == 1 {
-			break
-		}
-		// consume the two nodes in the list at a time and
-		// create a new Merkletree node and insert it back to
-		// the list
-		n0 := leafs[0]
-		n1 := leafs[1]
-
-		var position Position
-		if togglePos == 0 {
-			position = L
-		} else {
-			position = R
-		}
-		togglePos = (togglePos + 1) % 2
-		node := MerkleTree{
-			hash: hash(append(n0.hash[:], n1.hash[:] ...)),
-			left: &n0,
-			right: &n1,
-			depth: n0.depth+1,
-			pos: position,
-		}
+	return root
+}
 
-		leafs = leafs[2:]
-		leafs = append(leafs, node)
+// buildSubtree combines a non-empty slice of already-hashed nodes
+// (leaves or earlier subtrees) into a single node, following RFC
+// 6962's left-leaning split.
+func buildSubtree(newHash func() hash.Hash, nodes []*MerkleTree) *MerkleTree {
+	if len(nodes) == 1 {
+		return nodes[0]
 	}
 
-	leafs[0].pos = C
+	k := largestPow2LessThan(len(nodes))
+	left := buildSubtree(newHash, nodes[:k])
+	right := buildSubtree(newHash, nodes[k:])
+	left.pos = L
+	right.pos = R
+
+	depth := left.depth
+	if right.depth > depth {
+		depth = right.depth
+	}
 
-	return &leafs[0]
+	node := &MerkleTree{
+		hash:    nodeHash(newHash, left.hash, right.hash),
+		left:    left,
+		right:   right,
+		depth:   depth + 1,
+		newHash: newHash,
+	}
+	left.parent = node
+	right.parent = node
+	return node
 }
 
-// given a leaf node, return a list of Nodes (nodes already contain
-// their corresponding positions, which is needed to combine the
-// hashes the right way)
+// Proof returns a list of sibling nodes (bottom to top, already
+// carrying the Position needed to combine hashes the right way) that
+// prove chunk is a leaf of mTree. It looks chunk's leaf up via
+// leafIndex in O(1) and then walks parent pointers in O(log n); see
+// ProofByIndex.
 func (mTree *MerkleTree) Proof(chunk []byte) []*MerkleTree {
-	h := hash(chunk)
-	// fmt.Printf("finding the proof for %s\n", h)
-	node := mTree.findNode(h)
-	if node == nil {
-		fmt.Printf("could not find the node corresponding to the chunk\n")
+	h := leafHash(mTree.newHash, chunk)
+	index, ok := mTree.leafIndex[string(h)]
+	if !ok {
 		return []*MerkleTree{}
 	}
-	// verify that node is indeed a leaf node
-	if node.left != nil || node.right != nil {
-		return []*MerkleTree{}
-	}
-
-	// find the path from root to the node
-	pathToNode := mTree.findPath(node, []*MerkleTree{})
+	return mTree.ProofByIndex(index)
+}
 
-	if len(pathToNode) == 0 {
+// ProofByIndex returns the same kind of sibling list as Proof, for
+// the leaf at the given index, by walking from that leaf up to the
+// root via parent pointers -- O(log n) instead of the O(n) tree scan
+// Proof used to require.
+func (mTree *MerkleTree) ProofByIndex(index int) []*MerkleTree {
+	if index < 0 || index >= len(mTree.leaves) {
 		return []*MerkleTree{}
 	}
-	// now, for each node (starting from root), find the sibling
-	// node. i.e. if the node in the path is a L node, find the R
-	// node and vice versa. This list of node from bottom to top
-	// is our proof.
 
-	// assuming, the first node in our path is the root node, find
-	// sibling nodes
 	siblingNodes := []*MerkleTree{}
-	parentNode := pathToNode[0]
-	// fmt.Printf("length of the path: %d\n", len(pathToNode))
-	for i := 1; i < len(pathToNode); i++ {
-		n := pathToNode[i]
-		if parentNode.left.hash == n.hash {
-			siblingNodes = append([]*MerkleTree{parentNode.right}, siblingNodes ...)
-			parentNode = n
-			continue
-		}
-		if parentNode.right.hash == n.hash {
-			siblingNodes = append([]*MerkleTree{parentNode.left}, siblingNodes ...)
-			parentNode = n
-			continue
+	node := mTree.leaves[index]
+	for node.parent != nil {
+		parent := node.parent
+		if parent.left == node {
+			siblingNodes = append(siblingNodes, parent.right)
+		} else {
+			siblingNodes = append(siblingNodes, parent.left)
 		}
+		node = parent
 	}
-	// fmt.Printf("%d siblings: %#+v\n", len(siblingNodes), siblingNodes)
 	return siblingNodes
 }
 
@@ -175,64 +197,28 @@ func (mTree *MerkleTree) Verify(proof []*MerkleTree, chunk []byte) bool {
 	// we exhaust the proof list. At that point, the hash we have
 	// should match the root hash.
 
-	h := hash(chunk)
-	var pHash Hash
+	h := leafHash(mTree.newHash, chunk)
 	for _, p := range proof {
 		if p.pos == L {
-			pHash = hash(append(p.hash[:], h[:] ...))
+			h = nodeHash(mTree.newHash, p.hash, h)
 		} else {
-			pHash = hash(append(h[:], p.hash[:] ...))
+			h = nodeHash(mTree.newHash, h, p.hash)
 		}
-		h = pHash
-		fmt.Printf("intermediate node hash: %s\n", pHash)
 	}
 
-	// fmt.Printf("h = %s\n, rootHash = %s\n", h, mTree.hash)
-	return h == mTree.hash
+	return bytesEqual(h, mTree.hash)
 }
 
-func (mTree *MerkleTree) findNode(h Hash) *MerkleTree {
-	if mTree.hash == h {
-		return mTree
+func bytesEqual(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
 	}
-	if mTree.left != nil {
-		lN := mTree.left.findNode(h)
-		if lN != nil {
-			return lN
+	for i := range a {
+		if a[i] != b[i] {
+			return false
 		}
 	}
-	if mTree.right != nil {
-		rN := mTree.right.findNode(h)
-		if rN != nil {
-			return rN
-		}
-	}
-	return nil
-}
-// return path from root to given node, if the node is in the tree.
-func (mTree *MerkleTree) findPath(node *MerkleTree, path []*MerkleTree) []*MerkleTree {
-	if mTree == nil {
-		return []*MerkleTree{}
-	}
-
-	if mTree.hash == node.hash {
-		// we found the node
-		return append(path, node)
-	}
-
-	lPath := mTree.left.findPath(node, append(path, mTree))
-	if len(lPath) != 0 {
-		// we found a path
-		return lPath
-	}
-	rPath := mTree.right.findPath(node, append(path, mTree))
-	if len(rPath) != 0 {
-		return rPath
-	}
-
-	// if both of them returned no path, then return an empty
-	// slice
-	return []*MerkleTree{}
+	return true
 }
 
 func (mTree *MerkleTree) Depth() int {
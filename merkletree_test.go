@@ -1,9 +1,12 @@
 package merkletree
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"math"
 	"testing"
-	"fmt"
 )
 
 func TestNewMerkleTree(t *testing.T) {
@@ -14,7 +17,7 @@ func TestNewMerkleTree(t *testing.T) {
 		[]byte{3},
 	}
 
-	mTree := NewMerkleTree(chunks)
+	mTree := NewMerkleTree(sha1.New, chunks)
 	if mTree == nil {
 		t.Errorf("wanted a non-nil tree")
 	}
@@ -31,7 +34,7 @@ func TestMerkleTreeProof1(t *testing.T) {
 		[]byte{3},
 	}
 
-	mTree := NewMerkleTree(chunks)
+	mTree := NewMerkleTree(sha1.New, chunks)
 	if mTree == nil {
 		t.Errorf("wanted a non-nil tree")
 	}
@@ -45,3 +48,145 @@ func TestMerkleTreeProof1(t *testing.T) {
 		t.Errorf("verification of the proof for the given chunk of data failed\n")
 	}
 }
+
+// RFC 6962 domain-separation test vectors: leaf hashes are H(0x00 ||
+// data), node hashes are H(0x01 || left || right).
+// https://datatracker.ietf.org/doc/html/rfc6962#section-2.1
+func TestRFC6962DomainSeparation(t *testing.T) {
+	wantEmptyLeaf := "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d"
+	got := leafHash(sha256.New, []byte(""))
+	if hex.EncodeToString(got) != wantEmptyLeaf {
+		t.Errorf("leafHash(\"\") = %x, want %s", got, wantEmptyLeaf)
+	}
+
+	l := leafHash(sha256.New, []byte("L123456"))
+	n := leafHash(sha256.New, []byte("N123456"))
+
+	wantNode := "f1db09bc56f671850244c9b98c0cddf5b8b500f408808de950b46653f007ef75"
+	got = nodeHash(sha256.New, l, n)
+	if hex.EncodeToString(got) != wantNode {
+		t.Errorf("nodeHash(L123456, N123456) = %x, want %s", got, wantNode)
+	}
+
+	// a leaf hash must never equal a node hash computed over the
+	// same bytes, which is the whole point of the domain
+	// separation prefixes.
+	if bytesEqual(leafHash(sha256.New, append(append([]byte{}, l...), n...)), nodeHash(sha256.New, l, n)) {
+		t.Errorf("leaf hash collided with node hash")
+	}
+}
+
+func TestMerkleTreeProofSHA256(t *testing.T) {
+	chunks := [][]byte{
+		[]byte("L123456"),
+		[]byte("N123456"),
+		[]byte("N123457"),
+		[]byte("N123458"),
+	}
+
+	mTree := NewMerkleTree(sha256.New, chunks)
+	if mTree == nil {
+		t.Fatalf("wanted a non-nil tree")
+	}
+
+	for _, chunk := range chunks {
+		proof := mTree.Proof(chunk)
+		if !mTree.Verify(proof, chunk) {
+			t.Errorf("verification failed for chunk %q", chunk)
+		}
+	}
+}
+
+// non-power-of-2 leaf counts should build a tree (no corruption, no
+// nil) and every leaf should still produce a verifiable proof.
+func TestMerkleTreeNonPowerOfTwoLeaves(t *testing.T) {
+	for _, numLeaves := range []int{1, 3, 5, 6, 7} {
+		chunks := make([][]byte, numLeaves)
+		for i := range chunks {
+			chunks[i] = []byte{byte(i)}
+		}
+
+		mTree := NewMerkleTree(sha256.New, chunks)
+		if mTree == nil {
+			t.Fatalf("numLeaves=%d: wanted a non-nil tree", numLeaves)
+		}
+
+		for _, chunk := range chunks {
+			proof := mTree.Proof(chunk)
+			if !mTree.Verify(proof, chunk) {
+				t.Errorf("numLeaves=%d: verification failed for chunk %v", numLeaves, chunk)
+			}
+		}
+	}
+}
+
+// ProofByIndex should yield a verifiable proof for every leaf index,
+// and an empty proof for an index past the last leaf.
+func TestProofByIndex(t *testing.T) {
+	chunks := make([][]byte, 9)
+	for i := range chunks {
+		chunks[i] = []byte{byte(i)}
+	}
+
+	mTree := NewMerkleTree(sha256.New, chunks)
+	for i, chunk := range chunks {
+		proof := mTree.ProofByIndex(i)
+		if !mTree.Verify(proof, chunk) {
+			t.Errorf("index=%d: verification failed for chunk %v", i, chunk)
+		}
+	}
+
+	if got := mTree.ProofByIndex(len(chunks)); len(got) != 0 {
+		t.Errorf("out-of-range index should yield an empty proof, got %d entries", len(got))
+	}
+}
+
+// When a chunk repeats, Proof should resolve it to its first
+// (leftmost) occurrence, the same leaf leafIndex records for it.
+func TestMerkleTreeProofDuplicateChunks(t *testing.T) {
+	dup := []byte{7}
+	chunks := [][]byte{
+		[]byte{0},
+		dup,
+		[]byte{2},
+		dup,
+	}
+
+	mTree := NewMerkleTree(sha256.New, chunks)
+	if mTree == nil {
+		t.Fatalf("wanted a non-nil tree")
+	}
+
+	proof := mTree.Proof(dup)
+	wantProof := mTree.ProofByIndex(1)
+	if len(proof) != len(wantProof) {
+		t.Fatalf("Proof(dup) resolved to a different leaf than the first occurrence: got %d proof entries, want %d", len(proof), len(wantProof))
+	}
+	for i := range proof {
+		if !bytesEqual(proof[i].hash, wantProof[i].hash) {
+			t.Errorf("Proof(dup)[%d] = %x, want %x (first occurrence at index 1)", i, proof[i].hash, wantProof[i].hash)
+		}
+	}
+
+	if !mTree.Verify(proof, dup) {
+		t.Errorf("verification failed for duplicated chunk")
+	}
+}
+
+// BenchmarkProof measures proof generation for a large, non-trivial
+// tree: the indexed leafIndex lookup plus parent-pointer walk is
+// O(log n) in the leaf count.
+func BenchmarkProof(b *testing.B) {
+	const numLeaves = 1 << 16
+	chunks := make([][]byte, numLeaves)
+	for i := range chunks {
+		chunks[i] = []byte{byte(i), byte(i >> 8)}
+	}
+	mTree := NewMerkleTree(sha256.New, chunks)
+	target := chunks[numLeaves/3]
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mTree.Proof(target)
+	}
+}
@@ -0,0 +1,153 @@
+package merkletree
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// Flag values for the preorder flag stream produced by PartialTree
+// and consumed by ReconstructPartialTree. Unlike the classic
+// Bitcoin/Bytom merkle block format, this isn't bit-packed (one byte
+// per visited node rather than one bit) -- simplicity over wire
+// size, matching the rest of this package.
+const (
+	flagHash        byte = 0 // no match below; hashes[] holds this subtree's hash
+	flagDescend     byte = 1 // a match exists below; recurse into left then right
+	flagMatchedLeaf byte = 2 // this leaf itself matched; hashes[] holds its hash
+)
+
+var (
+	errShortHashes  = errors.New("merkletree: partial tree hash stream exhausted")
+	errTrailingData = errors.New("merkletree: partial tree has unconsumed flags or hashes")
+)
+
+// PartialTree performs a preorder walk of mTree, emitting one flag
+// per visited node: flagHash for a subtree with nothing matched below
+// it (its hash is appended to hashes and the walk doesn't descend),
+// flagDescend for an interior node with a match below (no hash
+// emitted, the walk continues into both children), and
+// flagMatchedLeaf for a leaf whose data is one of matched (its hash
+// is appended to hashes too, so the caller can recover it).
+//
+// Because a tree's shape is a deterministic function of its leaf
+// count (see largestPow2LessThan), ReconstructPartialTree can replay
+// this same recursion from numLeaves alone, without needing to tell
+// leaves and interior nodes apart by depth.
+func (mTree *MerkleTree) PartialTree(matched [][]byte) (hashes [][]byte, flags []byte) {
+	matchSet := make(map[string]bool, len(matched))
+	for _, m := range matched {
+		matchSet[string(m)] = true
+	}
+
+	anyMatch := make(map[*MerkleTree]bool)
+	var mark func(n *MerkleTree) bool
+	mark = func(n *MerkleTree) bool {
+		if n.left == nil && n.right == nil {
+			m := matchSet[string(n.data)]
+			anyMatch[n] = m
+			return m
+		}
+		// evaluate both sides unconditionally: || would short-circuit
+		// and leave the right subtree's descendants out of anyMatch.
+		l := mark(n.left)
+		r := mark(n.right)
+		m := l || r
+		anyMatch[n] = m
+		return m
+	}
+	mark(mTree)
+
+	var emit func(n *MerkleTree)
+	emit = func(n *MerkleTree) {
+		if n.left == nil && n.right == nil {
+			if anyMatch[n] {
+				flags = append(flags, flagMatchedLeaf)
+			} else {
+				flags = append(flags, flagHash)
+			}
+			hashes = append(hashes, n.hash)
+			return
+		}
+		if anyMatch[n] {
+			flags = append(flags, flagDescend)
+			emit(n.left)
+			emit(n.right)
+			return
+		}
+		flags = append(flags, flagHash)
+		hashes = append(hashes, n.hash)
+	}
+	emit(mTree)
+
+	return hashes, flags
+}
+
+// ReconstructPartialTree rebuilds the root hash of a numLeaves-leaf
+// tree from the (hashes, flags) pair produced by PartialTree, and
+// returns the hashes of every leaf that was flagged as matched. It
+// never needs more than the partial tree's own hashes and flags in
+// memory, unlike replaying the full leaf set through NewMerkleTree.
+func ReconstructPartialTree(h func() hash.Hash, numLeaves int, hashes [][]byte, flags []byte) (root []byte, matched [][]byte, err error) {
+	if numLeaves <= 0 {
+		return nil, nil, errors.New("merkletree: numLeaves must be positive")
+	}
+
+	fi, hi := 0, 0
+
+	var walk func(size int) ([]byte, error)
+	walk = func(size int) ([]byte, error) {
+		if fi >= len(flags) {
+			return nil, errors.New("merkletree: partial tree flag stream exhausted")
+		}
+		flag := flags[fi]
+		fi++
+
+		switch flag {
+		case flagHash:
+			if hi >= len(hashes) {
+				return nil, errShortHashes
+			}
+			v := hashes[hi]
+			hi++
+			return v, nil
+		case flagMatchedLeaf:
+			if size != 1 {
+				return nil, fmt.Errorf("merkletree: flagMatchedLeaf on a %d-leaf subtree", size)
+			}
+			if hi >= len(hashes) {
+				return nil, errShortHashes
+			}
+			v := hashes[hi]
+			hi++
+			matched = append(matched, v)
+			return v, nil
+		case flagDescend:
+			if size == 1 {
+				return nil, errors.New("merkletree: flagDescend on a leaf")
+			}
+			k := largestPow2LessThan(size)
+			left, err := walk(k)
+			if err != nil {
+				return nil, err
+			}
+			right, err := walk(size - k)
+			if err != nil {
+				return nil, err
+			}
+			return nodeHash(h, left, right), nil
+		default:
+			return nil, fmt.Errorf("merkletree: unknown partial tree flag %d", flag)
+		}
+	}
+
+	root, err = walk(numLeaves)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fi != len(flags) || hi != len(hashes) {
+		return nil, nil, errTrailingData
+	}
+
+	return root, matched, nil
+}
@@ -0,0 +1,57 @@
+package merkletree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestPartialTreeRoundTrip(t *testing.T) {
+	for _, numLeaves := range []int{1, 4, 5, 7} {
+		chunks := make([][]byte, numLeaves)
+		for i := range chunks {
+			chunks[i] = []byte{byte(i)}
+		}
+
+		mTree := NewMerkleTree(sha256.New, chunks)
+		matched := [][]byte{chunks[0], chunks[numLeaves-1]}
+
+		hashes, flags := mTree.PartialTree(matched)
+		root, got, err := ReconstructPartialTree(sha256.New, numLeaves, hashes, flags)
+		if err != nil {
+			t.Fatalf("numLeaves=%d: ReconstructPartialTree: %v", numLeaves, err)
+		}
+		if !bytesEqual(root, mTree.hash) {
+			t.Errorf("numLeaves=%d: reconstructed root does not match tree root", numLeaves)
+		}
+
+		wantMatch := map[string]bool{
+			string(leafHash(sha256.New, chunks[0])):           true,
+			string(leafHash(sha256.New, chunks[numLeaves-1])): true,
+		}
+		if len(got) != len(wantMatch) {
+			t.Fatalf("numLeaves=%d: got %d matched hashes, want %d", numLeaves, len(got), len(wantMatch))
+		}
+		for _, g := range got {
+			if !wantMatch[string(g)] {
+				t.Errorf("numLeaves=%d: unexpected matched hash %x", numLeaves, g)
+			}
+		}
+	}
+}
+
+func TestPartialTreeRejectsTamperedHash(t *testing.T) {
+	chunks := [][]byte{{0}, {1}, {2}, {3}, {4}}
+	mTree := NewMerkleTree(sha256.New, chunks)
+
+	hashes, flags := mTree.PartialTree([][]byte{chunks[2]})
+	hashes[0] = bytes.Repeat([]byte{0xff}, len(hashes[0]))
+
+	root, _, err := ReconstructPartialTree(sha256.New, len(chunks), hashes, flags)
+	if err != nil {
+		t.Fatalf("ReconstructPartialTree: %v", err)
+	}
+	if bytesEqual(root, mTree.hash) {
+		t.Errorf("tampered hash still reconstructed the original root")
+	}
+}
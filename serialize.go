@@ -0,0 +1,227 @@
+package merkletree
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash"
+	"reflect"
+)
+
+// hashRegistry lets (de)serialization round-trip a hash factory by
+// name: the wire format can't carry a func value, so MarshalBinary
+// records which well-known stdlib hash this tree was built with, and
+// UnmarshalBinary looks the constructor back up by that name.
+var hashRegistry = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"sha1", sha1.New},
+	{"sha256", sha256.New},
+	{"sha512", sha512.New},
+}
+
+func hashFuncName(newHash func() hash.Hash) (string, error) {
+	p := reflect.ValueOf(newHash).Pointer()
+	for _, entry := range hashRegistry {
+		if reflect.ValueOf(entry.new).Pointer() == p {
+			return entry.name, nil
+		}
+	}
+	return "", errors.New("merkletree: tree was built with a hash function that isn't registered for serialization")
+}
+
+func hashFuncByName(name string) (func() hash.Hash, error) {
+	for _, entry := range hashRegistry {
+		if entry.name == name {
+			return entry.new, nil
+		}
+	}
+	return nil, fmt.Errorf("merkletree: unknown hash function %q", name)
+}
+
+// wireNode and wireTree are the gob-friendly mirror of MerkleTree:
+// MerkleTree's fields are unexported (and newHash can't be encoded at
+// all), so (de)serialization goes through this exported shadow type
+// instead of relying on gob's default struct reflection.
+type wireNode struct {
+	Hash  []byte
+	Pos   Position
+	Depth int
+	Data  []byte // nil when the tree was marshaled with includeData=false
+	Left  *wireNode
+	Right *wireNode
+}
+
+type wireTree struct {
+	HashName string
+	Root     *wireNode
+}
+
+func toWireNode(n *MerkleTree, includeData bool) *wireNode {
+	if n == nil {
+		return nil
+	}
+	w := &wireNode{
+		Hash:  n.hash,
+		Pos:   n.pos,
+		Depth: n.depth,
+		Left:  toWireNode(n.left, includeData),
+		Right: toWireNode(n.right, includeData),
+	}
+	if includeData {
+		w.Data = n.data
+	}
+	return w
+}
+
+func fromWireNode(w *wireNode, newHash func() hash.Hash) *MerkleTree {
+	if w == nil {
+		return nil
+	}
+	n := &MerkleTree{
+		hash:    w.Hash,
+		pos:     w.Pos,
+		depth:   w.Depth,
+		data:    w.Data,
+		left:    fromWireNode(w.Left, newHash),
+		right:   fromWireNode(w.Right, newHash),
+		newHash: newHash,
+	}
+	if n.left != nil {
+		n.left.parent = n
+	}
+	if n.right != nil {
+		n.right.parent = n
+	}
+	return n
+}
+
+// reindexLeaves walks root's leaves left to right and (re)populates
+// root.leaves and root.leafIndex, so a deserialized tree supports
+// Proof and ProofByIndex the same as one built by NewMerkleTree.
+func reindexLeaves(root *MerkleTree) {
+	var leaves []*MerkleTree
+	var walk func(n *MerkleTree)
+	walk = func(n *MerkleTree) {
+		if n.left == nil && n.right == nil {
+			leaves = append(leaves, n)
+			return
+		}
+		walk(n.left)
+		walk(n.right)
+	}
+	walk(root)
+
+	root.leaves = leaves
+	root.leafIndex = make(map[string]int, len(leaves))
+	for i, l := range leaves {
+		// First occurrence wins, matching NewMerkleTree, so a
+		// repeated chunk resolves to the same leaf before and after
+		// a (de)serialization round trip.
+		if _, exists := root.leafIndex[string(l.hash)]; !exists {
+			root.leafIndex[string(l.hash)] = i
+		}
+	}
+}
+
+func (mTree *MerkleTree) marshal(includeData bool) ([]byte, error) {
+	name, err := hashFuncName(mTree.newHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	wt := wireTree{HashName: name, Root: toWireNode(mTree, includeData)}
+	if err := gob.NewEncoder(&buf).Encode(&wt); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalBinary encodes mTree, including every leaf's original data,
+// so that UnmarshalBinary fully restores the tree.
+func (mTree *MerkleTree) MarshalBinary() ([]byte, error) {
+	return mTree.marshal(true)
+}
+
+// MarshalBinaryOmitData is like MarshalBinary but leaves leaf data
+// out of the wire format, for when only the shape and hashes are
+// needed to verify proofs against.
+func (mTree *MerkleTree) MarshalBinaryOmitData() ([]byte, error) {
+	return mTree.marshal(false)
+}
+
+// UnmarshalBinary decodes data produced by MarshalBinary or
+// MarshalBinaryOmitData into mTree.
+func (mTree *MerkleTree) UnmarshalBinary(data []byte) error {
+	var wt wireTree
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&wt); err != nil {
+		return err
+	}
+	newHash, err := hashFuncByName(wt.HashName)
+	if err != nil {
+		return err
+	}
+
+	root := fromWireNode(wt.Root, newHash)
+	if root == nil {
+		return errors.New("merkletree: serialized tree has no root")
+	}
+	reindexLeaves(root)
+	*mTree = *root
+	return nil
+}
+
+// GobEncode and GobDecode make MerkleTree satisfy gob.GobEncoder and
+// gob.GobDecoder directly, using the same wire format as
+// MarshalBinary/UnmarshalBinary.
+func (mTree *MerkleTree) GobEncode() ([]byte, error) {
+	return mTree.MarshalBinary()
+}
+
+func (mTree *MerkleTree) GobDecode(data []byte) error {
+	return mTree.UnmarshalBinary(data)
+}
+
+// wireProofStep is the serializable form of one *MerkleTree entry in
+// a Proof() result: Verify only ever reads a proof step's hash and
+// position, so that's all MarshalProof needs to carry across a wire.
+type wireProofStep struct {
+	Hash []byte
+	Pos  Position
+}
+
+// MarshalProof encodes a proof returned by (*MerkleTree).Proof so it
+// can be sent to, or stored by, another process.
+func MarshalProof(proof []*MerkleTree) ([]byte, error) {
+	steps := make([]wireProofStep, len(proof))
+	for i, p := range proof {
+		steps[i] = wireProofStep{Hash: p.hash, Pos: p.pos}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(steps); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalProof decodes a proof produced by MarshalProof back into a
+// form (*MerkleTree).Verify accepts.
+func UnmarshalProof(data []byte) ([]*MerkleTree, error) {
+	var steps []wireProofStep
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&steps); err != nil {
+		return nil, err
+	}
+
+	proof := make([]*MerkleTree, len(steps))
+	for i, s := range steps {
+		proof[i] = &MerkleTree{hash: s.Hash, pos: s.Pos}
+	}
+	return proof, nil
+}
@@ -0,0 +1,131 @@
+package merkletree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"testing"
+)
+
+func TestMerkleTreeBinaryRoundTrip(t *testing.T) {
+	chunks := [][]byte{{0}, {1}, {2}, {3}, {4}}
+	mTree := NewMerkleTree(sha256.New, chunks)
+	proof := mTree.Proof(chunks[2])
+
+	data, err := mTree.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+
+	var got MerkleTree
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if !bytesEqual(got.hash, mTree.hash) {
+		t.Errorf("round-tripped tree has a different root hash")
+	}
+
+	// a proof computed before serialization should still verify
+	// against the deserialized tree.
+	if !got.Verify(proof, chunks[2]) {
+		t.Errorf("deserialized tree failed to verify a pre-serialization proof")
+	}
+}
+
+func TestMerkleTreeBinaryOmitData(t *testing.T) {
+	chunks := [][]byte{{0}, {1}, {2}, {3}}
+	mTree := NewMerkleTree(sha256.New, chunks)
+
+	data, err := mTree.MarshalBinaryOmitData()
+	if err != nil {
+		t.Fatalf("MarshalBinaryOmitData: %v", err)
+	}
+
+	var got MerkleTree
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	if !bytesEqual(got.hash, mTree.hash) {
+		t.Errorf("root hash should survive even without leaf data")
+	}
+	if got.left.left.data != nil {
+		t.Errorf("leaf data should have been omitted")
+	}
+}
+
+// A duplicate chunk should resolve to the same leaf before and after
+// a binary round trip: reindexLeaves must keep the first occurrence
+// the same way NewMerkleTree's leafIndex build does.
+func TestMerkleTreeBinaryRoundTripDuplicateChunks(t *testing.T) {
+	dup := []byte{7}
+	chunks := [][]byte{{0}, dup, {2}, dup}
+	mTree := NewMerkleTree(sha256.New, chunks)
+
+	data, err := mTree.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+
+	var got MerkleTree
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+
+	wantIndex := mTree.leafIndex[string(leafHash(sha256.New, dup))]
+	gotIndex := got.leafIndex[string(leafHash(sha256.New, dup))]
+	if gotIndex != wantIndex {
+		t.Errorf("Proof(dup) resolved to leaf %d before serialization but %d after", wantIndex, gotIndex)
+	}
+
+	proof := got.Proof(dup)
+	wantProof := got.ProofByIndex(wantIndex)
+	if len(proof) != len(wantProof) {
+		t.Fatalf("Proof(dup) on the deserialized tree has %d entries, want %d", len(proof), len(wantProof))
+	}
+	for i := range proof {
+		if !bytesEqual(proof[i].hash, wantProof[i].hash) {
+			t.Errorf("Proof(dup)[%d] = %x, want %x (first occurrence at index %d)", i, proof[i].hash, wantProof[i].hash, wantIndex)
+		}
+	}
+
+	if !got.Verify(proof, dup) {
+		t.Errorf("verification failed for duplicated chunk after round trip")
+	}
+}
+
+func TestMerkleTreeGobRoundTrip(t *testing.T) {
+	chunks := [][]byte{{0}, {1}, {2}, {3}}
+	mTree := NewMerkleTree(sha256.New, chunks)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(mTree); err != nil {
+		t.Fatalf("gob encode: %v", err)
+	}
+
+	var got MerkleTree
+	if err := gob.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatalf("gob decode: %v", err)
+	}
+	if !bytesEqual(got.hash, mTree.hash) {
+		t.Errorf("root hash mismatch after gob round trip")
+	}
+}
+
+func TestMarshalUnmarshalProof(t *testing.T) {
+	chunks := [][]byte{{0}, {1}, {2}, {3}, {4}, {5}}
+	mTree := NewMerkleTree(sha256.New, chunks)
+	proof := mTree.Proof(chunks[4])
+
+	data, err := MarshalProof(proof)
+	if err != nil {
+		t.Fatalf("MarshalProof: %v", err)
+	}
+
+	got, err := UnmarshalProof(data)
+	if err != nil {
+		t.Fatalf("UnmarshalProof: %v", err)
+	}
+	if !mTree.Verify(got, chunks[4]) {
+		t.Errorf("verification failed using an unmarshaled proof")
+	}
+}
@@ -0,0 +1,215 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"io"
+	"math/bits"
+)
+
+var (
+	ErrEmptyReader     = errors.New("merkletree: reader produced no data")
+	ErrProofIndexRange = errors.New("merkletree: proofIndex out of range")
+)
+
+// level tracks the state of one "peak" of the in-progress tree: a
+// completed subtree whose hash hasn't been folded into a bigger
+// subtree yet. This is the same incremental, binary-counter style
+// construction RFC 6962 logs use to keep an append-only tree's
+// frontier at O(log n) nodes: adding the n-th leaf merges pairs of
+// equal-sized peaks the same way a binary counter carries bits.
+type level struct {
+	occupied bool
+	hash     []byte
+	onPath   bool
+}
+
+// BuildReaderProof reads r in segmentSize chunks, hashing each chunk
+// as a leaf (RFC 6962 domain separation, see leafHash/nodeHash) and
+// folding the running peaks incrementally, so that memory stays
+// O(log n) in the number of leaves rather than requiring every leaf
+// to be materialized up front as with NewMerkleTree. Alongside the
+// root it returns an inclusion proof for the leaf at proofIndex.
+//
+// The returned proof is self-contained: proof[0] is the hash of the
+// leaf at proofIndex, and proof[1:] are the sibling hashes needed to
+// recompute the root, in the order VerifyProof expects to consume
+// them.
+func BuildReaderProof(r io.Reader, h func() hash.Hash, segmentSize int, proofIndex uint64) (root []byte, proof [][]byte, numLeaves uint64, err error) {
+	if segmentSize <= 0 {
+		return nil, nil, 0, errors.New("merkletree: segmentSize must be positive")
+	}
+
+	var levels []level
+	pathLevel := -1
+	var pathLeafHash []byte
+
+	buf := make([]byte, segmentSize)
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			chunk := buf[:n]
+			isTarget := numLeaves == proofIndex
+			pending := leafHash(h, chunk)
+			pendingOnPath := isTarget
+			if isTarget {
+				pathLeafHash = pending
+			}
+
+			l := 0
+			for l < len(levels) && levels[l].occupied {
+				switch {
+				case levels[l].onPath:
+					proof = append(proof, pending)
+					pending = nodeHash(h, levels[l].hash, pending)
+					pendingOnPath = true
+				case pendingOnPath:
+					proof = append(proof, levels[l].hash)
+					pending = nodeHash(h, levels[l].hash, pending)
+				default:
+					pending = nodeHash(h, levels[l].hash, pending)
+				}
+				levels[l].occupied = false
+				levels[l].onPath = false
+				l++
+			}
+			if l == len(levels) {
+				levels = append(levels, level{occupied: true, hash: pending, onPath: pendingOnPath})
+			} else {
+				levels[l] = level{occupied: true, hash: pending, onPath: pendingOnPath}
+			}
+			if pendingOnPath {
+				pathLevel = l
+			}
+
+			numLeaves++
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return nil, nil, 0, readErr
+		}
+	}
+
+	if numLeaves == 0 {
+		return nil, nil, 0, ErrEmptyReader
+	}
+	if proofIndex >= numLeaves {
+		return nil, nil, 0, ErrProofIndexRange
+	}
+
+	var running []byte
+	for i := range levels {
+		if !levels[i].occupied {
+			continue
+		}
+		isPath := i == pathLevel
+		if !isPath {
+			proof = append(proof, levels[i].hash)
+		}
+		if running == nil {
+			running = levels[i].hash
+		} else {
+			running = nodeHash(h, levels[i].hash, running)
+		}
+	}
+
+	proof = append([][]byte{pathLeafHash}, proof...)
+	return running, proof, numLeaves, nil
+}
+
+// VerifyProof checks that proof (as returned by BuildReaderProof)
+// proves inclusion of proof[0] as the leaf at proofIndex in a tree of
+// numLeaves leaves with the given root.
+//
+// numLeaves' peaks are exactly its set bits (the same binary-counter
+// invariant BuildReaderProof maintains while streaming), each a
+// complete 2^bit-sized subtree, ordered front-to-back in the leaf
+// stream from its highest bit to its lowest. This derives which peak
+// holds proofIndex and where the other peaks fall directly from that
+// bit pattern, so cost is O(log numLeaves) -- bounded by len(proof),
+// not by numLeaves -- rather than replaying BuildReaderProof's whole
+// incremental construction one leaf at a time.
+func VerifyProof(h func() hash.Hash, root []byte, proof [][]byte, proofIndex, numLeaves uint64) bool {
+	if len(proof) == 0 || numLeaves == 0 || proofIndex >= numLeaves {
+		return false
+	}
+
+	next := 1
+	take := func() ([]byte, bool) {
+		if next >= len(proof) {
+			return nil, false
+		}
+		v := proof[next]
+		next++
+		return v, true
+	}
+
+	topBit := bits.Len64(numLeaves) - 1
+
+	// Find the peak containing proofIndex by walking the leaf stream
+	// in the same highest-bit-first order BuildReaderProof's peaks
+	// appear in, and recompute that peak's root from proof[0] via a
+	// standard indexed binary-tree path.
+	pathLevel := -1
+	localIndex := proofIndex
+	offset := uint64(0)
+	for p := topBit; p >= 0; p-- {
+		if numLeaves&(1<<uint(p)) == 0 {
+			continue
+		}
+		blockSize := uint64(1) << uint(p)
+		if proofIndex >= offset && proofIndex < offset+blockSize {
+			pathLevel = p
+			localIndex = proofIndex - offset
+			break
+		}
+		offset += blockSize
+	}
+	if pathLevel < 0 {
+		return false
+	}
+
+	current := proof[0]
+	for level := 0; level < pathLevel; level++ {
+		sib, ok := take()
+		if !ok {
+			return false
+		}
+		if (localIndex>>uint(level))&1 == 0 {
+			current = nodeHash(h, current, sib)
+		} else {
+			current = nodeHash(h, sib, current)
+		}
+	}
+
+	// Fold in the remaining peaks low bit to high bit, the same
+	// order BuildReaderProof's final combine loop used, substituting
+	// the recomputed path peak for the one matching pathLevel instead
+	// of consuming a proof entry for it.
+	var running []byte
+	for p := 0; p <= topBit; p++ {
+		if numLeaves&(1<<uint(p)) == 0 {
+			continue
+		}
+		var peak []byte
+		if p == pathLevel {
+			peak = current
+		} else {
+			var ok bool
+			peak, ok = take()
+			if !ok {
+				return false
+			}
+		}
+		if running == nil {
+			running = peak
+		} else {
+			running = nodeHash(h, peak, running)
+		}
+	}
+
+	return bytes.Equal(running, root)
+}
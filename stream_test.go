@@ -0,0 +1,66 @@
+package merkletree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestBuildReaderProofRoundTrip(t *testing.T) {
+	for _, numLeaves := range []int{1, 2, 3, 5, 6, 7, 8, 13} {
+		data := make([]byte, 0, numLeaves*4)
+		for i := 0; i < numLeaves; i++ {
+			data = append(data, byte(i), byte(i+1), byte(i+2), byte(i+3))
+		}
+
+		for proofIndex := 0; proofIndex < numLeaves; proofIndex++ {
+			root, proof, n, err := BuildReaderProof(bytes.NewReader(data), sha256.New, 4, uint64(proofIndex))
+			if err != nil {
+				t.Fatalf("numLeaves=%d proofIndex=%d: BuildReaderProof: %v", numLeaves, proofIndex, err)
+			}
+			if n != uint64(numLeaves) {
+				t.Fatalf("numLeaves=%d proofIndex=%d: got numLeaves %d", numLeaves, proofIndex, n)
+			}
+			if !VerifyProof(sha256.New, root, proof, uint64(proofIndex), n) {
+				t.Errorf("numLeaves=%d proofIndex=%d: VerifyProof failed", numLeaves, proofIndex)
+			}
+		}
+	}
+}
+
+func TestBuildReaderProofRejectsBadProofIndex(t *testing.T) {
+	data := []byte{0, 1, 2, 3, 4, 5}
+	if _, _, _, err := BuildReaderProof(bytes.NewReader(data), sha256.New, 2, 10); err != ErrProofIndexRange {
+		t.Errorf("expected ErrProofIndexRange, got %v", err)
+	}
+}
+
+func TestVerifyProofRejectsTamperedRoot(t *testing.T) {
+	data := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	root, proof, n, err := BuildReaderProof(bytes.NewReader(data), sha256.New, 2, 1)
+	if err != nil {
+		t.Fatalf("BuildReaderProof: %v", err)
+	}
+	root[0] ^= 0xff
+	if VerifyProof(sha256.New, root, proof, 1, n) {
+		t.Errorf("VerifyProof accepted a tampered root")
+	}
+}
+
+// BenchmarkVerifyProof measures verification cost for a large stream:
+// with the old replay-the-whole-construction loop this scaled
+// linearly with numLeaves, while the bit-pattern-driven rewrite added
+// here is O(log numLeaves), bounded by len(proof).
+func BenchmarkVerifyProof(b *testing.B) {
+	const numLeaves = 1 << 21
+	data := make([]byte, numLeaves*4)
+	root, proof, n, err := BuildReaderProof(bytes.NewReader(data), sha256.New, 4, numLeaves/3)
+	if err != nil {
+		b.Fatalf("BuildReaderProof: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		VerifyProof(sha256.New, root, proof, numLeaves/3, n)
+	}
+}